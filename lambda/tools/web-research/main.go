@@ -6,11 +6,29 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
+// defaultMaxConcurrency is the number of topics researched in parallel when
+// PPLX_MAX_CONCURRENCY is not set.
+const defaultMaxConcurrency = 4
+
+// deadlineMargin is reserved at the end of the Lambda's remaining deadline so
+// the handler has time to marshal and return a partial result.
+const deadlineMargin = 2 * time.Second
+
+// Defaults applied to research_company_deep requests that don't override
+// them explicitly, tuned for longer-form research.
+const (
+	defaultDeepResearchModel     = "sonar-pro"
+	defaultDeepResearchMaxTokens = 2000
+)
+
 // ToolEvent represents the incoming event structure
 type ToolEvent struct {
 	ID    string          `json:"id"`
@@ -29,14 +47,24 @@ type ToolResponse struct {
 
 // ResearchInput represents the input structure for company research
 type ResearchInput struct {
-	Company string   `json:"company"`
-	Topics  []string `json:"topics,omitempty"`
+	Company                string   `json:"company"`
+	Topics                 []string `json:"topics,omitempty"`
+	Model                  string   `json:"model,omitempty"`
+	Temperature            *float64 `json:"temperature,omitempty"`
+	MaxTokens              int      `json:"max_tokens,omitempty"`
+	SearchRecencyFilter    string   `json:"search_recency_filter,omitempty"`
+	SearchDomainFilter     []string `json:"search_domain_filter,omitempty"`
+	ReturnRelatedQuestions bool     `json:"return_related_questions,omitempty"`
+	OutputMode             string   `json:"output_mode,omitempty"`
+	Locale                 string   `json:"locale,omitempty"`
 }
 
 // ResearchResult represents the structured research result
 type ResearchResult struct {
-	Company     string            `json:"company"`
-	Information map[string]string `json:"information"`
+	Company     string              `json:"company"`
+	Information map[string]string   `json:"information"`
+	Sources     map[string][]string `json:"sources,omitempty"`
+	Errors      map[string]string   `json:"errors,omitempty"`
 }
 
 // handler is our lambda handler invoked by the `lambda.Start` function
@@ -83,20 +111,38 @@ func handler(ctx context.Context, event ToolEvent) (ToolResponse, error) {
 	}
 
 	switch event.Name {
-	case "research_company":
+	case "research_company", "research_company_deep":
 		var input ResearchInput
 		if err := json.Unmarshal(event.Input, &input); err != nil {
 			log.Printf("[ERROR] Failed to parse input: %v", err)
 			response.Content = fmt.Sprintf("Error parsing input: %v", err)
 			return response, nil
 		}
-		
-		log.Printf("[INFO] Processing research_company request for: %s", input.Company)
+
+		if event.Name == "research_company_deep" {
+			input = applyDeepResearchDefaults(input)
+		}
+
+		if input.Model != "" && !AllowedPerplexityModels[input.Model] {
+			log.Printf("[ERROR] Unsupported Perplexity model requested: %s", input.Model)
+			response.Content = fmt.Sprintf("Error: unsupported model %q", input.Model)
+			return response, nil
+		}
+
+		log.Printf("[INFO] Processing %s request for: %s (model: %s)", event.Name, input.Company, input.Model)
 		if isDebug {
 			log.Printf("[DEBUG] Research topics: %v", input.Topics)
 		}
 
 		result, err := researchCompany(ctx, apiKey, input, isDebug)
+		if err != nil && isAuthError(err) {
+			log.Printf("[WARNING] Perplexity rejected the cached API key, invalidating secrets cache and retrying once: %v", err)
+			ClearCache()
+			refreshedKey, keyErr := GetSecretValue(ctx, "web-research", "PPLX_API_KEY", "")
+			if keyErr == nil && refreshedKey != "" {
+				result, err = researchCompany(ctx, refreshedKey, input, isDebug)
+			}
+		}
 		if err != nil {
 			log.Printf("[ERROR] Research failed: %v", err)
 			response.Content = fmt.Sprintf("Error performing research: %v", err)
@@ -110,8 +156,15 @@ func handler(ctx context.Context, event ToolEvent) (ToolResponse, error) {
 			return response, nil
 		}
 
+		content, err := resolveResultContent(ctx, event.ID, input.OutputMode, resultJSON)
+		if err != nil {
+			log.Printf("[ERROR] Failed to resolve result content: %v", err)
+			response.Content = fmt.Sprintf("Error delivering result: %v", err)
+			return response, nil
+		}
+
 		log.Printf("[INFO] Research completed successfully for company: %s", input.Company)
-		response.Content = string(resultJSON)
+		response.Content = content
 
 	default:
 		log.Printf("[ERROR] Unknown tool requested: %s", event.Name)
@@ -121,12 +174,26 @@ func handler(ctx context.Context, event ToolEvent) (ToolResponse, error) {
 	return response, nil
 }
 
+// applyDeepResearchDefaults fills in the long-form research defaults for
+// research_company_deep requests that don't specify them explicitly.
+func applyDeepResearchDefaults(input ResearchInput) ResearchInput {
+	if input.Model == "" {
+		input.Model = defaultDeepResearchModel
+	}
+	if input.MaxTokens == 0 {
+		input.MaxTokens = defaultDeepResearchMaxTokens
+	}
+	return input
+}
+
 func researchCompany(ctx context.Context, apiKey string, input ResearchInput, isDebug bool) (ResearchResult, error) {
 	log.Printf("[INFO] Initializing Perplexity client for company: %s", input.Company)
 	client := NewPerplexityClient(apiKey)
 	result := ResearchResult{
 		Company:     input.Company,
 		Information: make(map[string]string),
+		Sources:     make(map[string][]string),
+		Errors:      make(map[string]string),
 	}
 
 	// If no specific topics provided, use default ones
@@ -140,47 +207,143 @@ func researchCompany(ctx context.Context, apiKey string, input ResearchInput, is
 		log.Printf("[INFO] Using default topics for research")
 	}
 
+	concurrency := getMaxConcurrency()
+	log.Printf("[INFO] Researching %d topics with max concurrency %d", len(input.Topics), concurrency)
+
+	opts := CompletionOptions{
+		Model:                  input.Model,
+		Temperature:            input.Temperature,
+		MaxTokens:              input.MaxTokens,
+		SearchRecencyFilter:    input.SearchRecencyFilter,
+		SearchDomainFilter:     input.SearchDomainFilter,
+		ReturnRelatedQuestions: input.ReturnRelatedQuestions,
+	}
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, concurrency)
+		firstErr error
+	)
+
 	for i, topic := range input.Topics {
-		prompt := fmt.Sprintf(
-			"Provide a concise summary of %s's %s. Focus on the most recent and relevant information. "+
-				"Keep the response factual and under 100 words.",
-			input.Company, topic,
-		)
-		
-		log.Printf("[INFO] Researching topic %d/%d: %s", i+1, len(input.Topics), topic)
-		if isDebug {
-			log.Printf("[DEBUG] Prompt: %s", prompt)
-		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, topic string) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-		res, err := client.CreateCompletion(ctx, []PerplexityMessage{
-			{
-				Role:    "user",
-				Content: prompt,
-			},
-		}, isDebug)
+			// Each topic gets its own context.WithTimeout derived from the
+			// Lambda's remaining deadline, so one slow topic times out on
+			// its own budget instead of starving the others via a shared
+			// cancel channel.
+			topicCtx := ctx
+			cancel := func() {}
+			if topicTimeout := topicDeadlineTimeout(ctx); topicTimeout > 0 {
+				topicCtx, cancel = context.WithTimeout(ctx, topicTimeout)
+			}
+			defer cancel()
 
-		if err != nil {
-			log.Printf("[ERROR] Perplexity API error for topic '%s': %v", topic, err)
+			prompt, err := renderTopicPrompt(ctx, TopicPromptData{
+				Company:       input.Company,
+				Topic:         topic,
+				RecencyWindow: input.SearchRecencyFilter,
+				Locale:        input.Locale,
+			})
+			if err != nil {
+				log.Printf("[ERROR] Failed to render prompt for topic '%s': %v", topic, err)
+				mu.Lock()
+				result.Errors[topic] = fmt.Sprintf("error rendering prompt for %s - %s: %v", input.Company, topic, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				return
+			}
+
+			log.Printf("[INFO] Researching topic %d/%d: %s", i+1, len(input.Topics), topic)
 			if isDebug {
-				// Log more details about the error
-				log.Printf("[DEBUG] Full error details: %+v", err)
+				log.Printf("[DEBUG] Prompt: %s", prompt)
 			}
-			return result, fmt.Errorf("error researching %s - %s: %v", input.Company, topic, err)
-		}
 
-		if isDebug {
-			log.Printf("[DEBUG] Response received for topic '%s'", topic)
-		}
-		
-		content := strings.TrimSpace(res.GetLastContent())
-		result.Information[topic] = content
-		log.Printf("[INFO] Successfully researched topic: %s (response length: %d chars)", topic, len(content))
+			res, err := client.CreateCompletion(topicCtx, []PerplexityMessage{
+				{
+					Role:    "user",
+					Content: prompt,
+				},
+			}, opts, isDebug)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				log.Printf("[ERROR] Perplexity API error for topic '%s': %v", topic, err)
+				result.Errors[topic] = fmt.Sprintf("error researching %s - %s: %v", input.Company, topic, err)
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+
+			if isDebug {
+				log.Printf("[DEBUG] Response received for topic '%s'", topic)
+			}
+
+			content := strings.TrimSpace(res.GetLastContent())
+			result.Information[topic] = content
+			if citations := res.GetCitations(); len(citations) > 0 {
+				result.Sources[topic] = citations
+			}
+			log.Printf("[INFO] Successfully researched topic: %s (response length: %d chars, citations: %d)", topic, len(content), len(res.GetCitations()))
+		}(i, topic)
+	}
+
+	wg.Wait()
+
+	if len(result.Errors) == len(input.Topics) {
+		return result, fmt.Errorf("error researching %s: all %d topics failed: %w", input.Company, len(input.Topics), firstErr)
 	}
 
-	log.Printf("[INFO] Completed research for all %d topics", len(input.Topics))
+	log.Printf("[INFO] Completed research for %d/%d topics (%d failed)", len(result.Information), len(input.Topics), len(result.Errors))
 	return result, nil
 }
 
+// getMaxConcurrency returns the worker pool size for topic fan-out, read from
+// PPLX_MAX_CONCURRENCY and falling back to defaultMaxConcurrency.
+func getMaxConcurrency() int {
+	raw := os.Getenv("PPLX_MAX_CONCURRENCY")
+	if raw == "" {
+		return defaultMaxConcurrency
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("[WARNING] Invalid PPLX_MAX_CONCURRENCY %q, using default %d", raw, defaultMaxConcurrency)
+		return defaultMaxConcurrency
+	}
+
+	return n
+}
+
+// topicDeadlineTimeout computes the per-topic timeout derived from the
+// Lambda's remaining execution deadline, reserving deadlineMargin so the
+// handler still has time to assemble a response after every topic's
+// independent context.WithTimeout expires. Returns 0 if ctx carries no
+// deadline, meaning callers should use ctx as-is.
+func topicDeadlineTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+
+	remaining := time.Until(deadline) - deadlineMargin
+	if remaining <= 0 {
+		return 0
+	}
+
+	return remaining
+}
+
 func main() {
 	// Initialize logging
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
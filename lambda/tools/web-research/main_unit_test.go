@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func templateMustParse(name, src string) *template.Template {
+	return template.Must(template.New(name).Parse(src))
+}
+
+func TestGetMaxConcurrency(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{name: "unset falls back to default", env: "", want: defaultMaxConcurrency},
+		{name: "valid override", env: "2", want: 2},
+		{name: "invalid override falls back to default", env: "not-a-number", want: defaultMaxConcurrency},
+		{name: "non-positive override falls back to default", env: "0", want: defaultMaxConcurrency},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("PPLX_MAX_CONCURRENCY", tc.env)
+			assert.Equal(t, tc.want, getMaxConcurrency())
+		})
+	}
+}
+
+// fakePerplexityServer answers /chat/completions, succeeding for topics in
+// okTopics and returning a 500 for every other topic, so researchCompany's
+// partial-failure aggregation can be exercised without the live API.
+func fakePerplexityServer(t *testing.T, okTopics map[string]bool) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PerplexityRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		var topic string
+		if len(req.Messages) > 0 {
+			topic = req.Messages[0].Content
+		}
+
+		if !okTopics[topic] {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]string{"message": "boom", "type": "server_error"},
+			})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(PerplexityResponse{
+			Choices: []PerplexityChoice{{Message: PerplexityMessage{Content: "answer: " + topic}}},
+		})
+	}))
+}
+
+func withPerplexityBaseURL(t *testing.T, url string) {
+	t.Helper()
+	prev := perplexityBaseURL
+	perplexityBaseURL = url
+	t.Cleanup(func() { perplexityBaseURL = prev })
+}
+
+func TestResearchCompanyPartialFailureAggregation(t *testing.T) {
+	withTemplateRegistry(t, map[string]*template.Template{
+		defaultTemplateKey: templateMustParse(defaultTemplateKey, "{{.Topic}}"),
+	})
+
+	server := fakePerplexityServer(t, map[string]bool{"topic-a": true})
+	defer server.Close()
+	withPerplexityBaseURL(t, server.URL)
+	t.Setenv("PPLX_MAX_RETRIES", "0")
+
+	input := ResearchInput{
+		Company: "Acme",
+		Topics:  []string{"topic-a", "topic-b"},
+	}
+
+	result, err := researchCompany(context.Background(), "test-key", input, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "answer: topic-a", result.Information["topic-a"])
+	assert.Contains(t, result.Errors, "topic-b")
+	assert.NotContains(t, result.Information, "topic-b")
+}
+
+func TestResearchCompanyAllTopicsFail(t *testing.T) {
+	withTemplateRegistry(t, map[string]*template.Template{
+		defaultTemplateKey: templateMustParse(defaultTemplateKey, "{{.Topic}}"),
+	})
+
+	server := fakePerplexityServer(t, map[string]bool{})
+	defer server.Close()
+	withPerplexityBaseURL(t, server.URL)
+	t.Setenv("PPLX_MAX_RETRIES", "0")
+
+	input := ResearchInput{
+		Company: "Acme",
+		Topics:  []string{"topic-a", "topic-b"},
+	}
+
+	_, err := researchCompany(context.Background(), "test-key", input, false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "all 2 topics failed")
+}
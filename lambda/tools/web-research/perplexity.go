@@ -4,17 +4,48 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 )
 
 // PerplexityRequest represents the request structure for Perplexity API
 type PerplexityRequest struct {
-	Model    string              `json:"model"`
-	Messages []PerplexityMessage `json:"messages"`
+	Model                  string              `json:"model"`
+	Messages               []PerplexityMessage `json:"messages"`
+	Temperature            *float64            `json:"temperature,omitempty"`
+	MaxTokens              int                 `json:"max_tokens,omitempty"`
+	SearchRecencyFilter    string              `json:"search_recency_filter,omitempty"`
+	SearchDomainFilter     []string            `json:"search_domain_filter,omitempty"`
+	ReturnRelatedQuestions bool                `json:"return_related_questions,omitempty"`
+}
+
+// CompletionOptions carries the per-request tuning knobs layered on top of a
+// CreateCompletion call. The zero value requests the Perplexity defaults.
+type CompletionOptions struct {
+	Model                  string
+	Temperature            *float64
+	MaxTokens              int
+	SearchRecencyFilter    string
+	SearchDomainFilter     []string
+	ReturnRelatedQuestions bool
+}
+
+// AllowedPerplexityModels whitelists the Perplexity model IDs this tool will
+// submit requests for. Unknown models are rejected before the call reaches
+// the upstream API.
+var AllowedPerplexityModels = map[string]bool{
+	"sonar":               true,
+	"sonar-pro":           true,
+	"sonar-reasoning":     true,
+	"sonar-reasoning-pro": true,
+	"sonar-deep-research": true,
 }
 
 // PerplexityMessage represents a message in the Perplexity API
@@ -25,13 +56,14 @@ type PerplexityMessage struct {
 
 // PerplexityResponse represents the response from Perplexity API
 type PerplexityResponse struct {
-	ID      string                   `json:"id"`
-	Model   string                   `json:"model"`
-	Object  string                   `json:"object"`
-	Created int64                    `json:"created"`
-	Choices []PerplexityChoice       `json:"choices"`
-	Usage   PerplexityUsage          `json:"usage"`
-	Error   *PerplexityError         `json:"error,omitempty"`
+	ID        string             `json:"id"`
+	Model     string             `json:"model"`
+	Object    string             `json:"object"`
+	Created   int64              `json:"created"`
+	Choices   []PerplexityChoice `json:"choices"`
+	Usage     PerplexityUsage    `json:"usage"`
+	Citations []string           `json:"citations,omitempty"`
+	Error     *PerplexityError   `json:"error,omitempty"`
 }
 
 // PerplexityChoice represents a choice in the response
@@ -60,25 +92,61 @@ type PerplexityClient struct {
 	apiKey     string
 	httpClient *http.Client
 	baseURL    string
+	maxRetries int
 }
 
+// perplexityBaseURL is the Perplexity API base URL used by new clients.
+// Overridable by tests so researchCompany's fan-out can be exercised against
+// an httptest server instead of the live API.
+var perplexityBaseURL = "https://api.perplexity.ai"
+
 // NewPerplexityClient creates a new Perplexity API client
 func NewPerplexityClient(apiKey string) *PerplexityClient {
+	maxRetries := defaultMaxRetries
+	if raw := os.Getenv("PPLX_MAX_RETRIES"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n >= 0 {
+			maxRetries = n
+		} else {
+			log.Printf("[WARNING] Invalid PPLX_MAX_RETRIES %q, using default %d", raw, defaultMaxRetries)
+		}
+	}
+
 	return &PerplexityClient{
 		apiKey: apiKey,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		baseURL: "https://api.perplexity.ai",
+		baseURL:    perplexityBaseURL,
+		maxRetries: maxRetries,
 	}
 }
 
-// CreateCompletion sends a request to the Perplexity API
-func (c *PerplexityClient) CreateCompletion(ctx context.Context, messages []PerplexityMessage, isDebug bool) (*PerplexityResponse, error) {
-	// Use sonar model for web search capabilities
+// retryableStatus reports whether a response status code warrants a retry.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// CreateCompletion sends a request to the Perplexity API, retrying transient
+// failures with exponential backoff and full jitter, and short-circuiting
+// through a per-host circuit breaker during sustained outages.
+func (c *PerplexityClient) CreateCompletion(ctx context.Context, messages []PerplexityMessage, opts CompletionOptions, isDebug bool) (*PerplexityResponse, error) {
+	model := opts.Model
+	if model == "" {
+		// Default to sonar for web search capabilities
+		model = "sonar"
+	}
+	if !AllowedPerplexityModels[model] {
+		return nil, fmt.Errorf("unsupported Perplexity model: %s", model)
+	}
+
 	request := PerplexityRequest{
-		Model:    "sonar",
-		Messages: messages,
+		Model:                  model,
+		Messages:               messages,
+		Temperature:            opts.Temperature,
+		MaxTokens:              opts.MaxTokens,
+		SearchRecencyFilter:    opts.SearchRecencyFilter,
+		SearchDomainFilter:     opts.SearchDomainFilter,
+		ReturnRelatedQuestions: opts.ReturnRelatedQuestions,
 	}
 
 	jsonData, err := json.Marshal(request)
@@ -90,9 +158,93 @@ func (c *PerplexityClient) CreateCompletion(ctx context.Context, messages []Perp
 		log.Printf("[DEBUG] Sending request to Perplexity API: %s", string(jsonData))
 	}
 
+	host := c.baseURL
+	if parsed, err := url.Parse(c.baseURL); err == nil {
+		host = parsed.Host
+	}
+	breaker := getCircuitBreaker(host)
+
+	var lastErr error
+	for attempt := 0; attempt <= c.maxRetries; attempt++ {
+		if !breaker.allow() {
+			log.Printf("[WARNING] Circuit breaker open for %s, short-circuiting request", host)
+			emitEMFMetric("CircuitOpen", 1)
+			if lastErr != nil {
+				return nil, fmt.Errorf("circuit breaker open for %s (last error: %v)", host, lastErr)
+			}
+			return nil, fmt.Errorf("circuit breaker open for %s", host)
+		}
+
+		if attempt > 0 {
+			emitEMFMetric("PerplexityRetries", 1)
+		}
+
+		response, retryAfter, err := c.doRequest(ctx, jsonData, isDebug)
+		if err == nil {
+			breaker.recordSuccess()
+			return response, nil
+		}
+
+		lastErr = err
+		retryable := isRetryableErr(err)
+		if retryable {
+			// Only count retryable (transport/5xx/429) failures toward the
+			// breaker; a 400/401/403 is a client-side problem, not evidence
+			// of an upstream outage, and must not trip the breaker.
+			breaker.recordFailure()
+		}
+
+		if !retryable || attempt == c.maxRetries {
+			return nil, err
+		}
+
+		delay := retryDelay(attempt, retryAfter)
+		log.Printf("[WARNING] Perplexity request failed (attempt %d/%d), retrying in %s: %v", attempt+1, c.maxRetries+1, delay, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+
+	return nil, lastErr
+}
+
+// retryableError wraps a request failure with whether it is worth retrying
+// and, for non-200 responses, the Retry-After duration the upstream requested.
+type retryableError struct {
+	err        error
+	retryAfter time.Duration
+	retryable  bool
+	statusCode int
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func isRetryableErr(err error) bool {
+	re, ok := err.(*retryableError)
+	return ok && re.retryable
+}
+
+// isAuthError reports whether err represents a 401/403 from the Perplexity
+// API, which generally means the cached API key has been rotated.
+func isAuthError(err error) bool {
+	var re *retryableError
+	if !errors.As(err, &re) {
+		return false
+	}
+	return re.statusCode == http.StatusUnauthorized || re.statusCode == http.StatusForbidden
+}
+
+// doRequest performs a single attempt against the Perplexity API. The
+// returned duration is the Retry-After delay requested by a non-200 response,
+// if any.
+func (c *PerplexityClient) doRequest(ctx context.Context, jsonData []byte, isDebug bool) (*PerplexityResponse, time.Duration, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, 0, &retryableError{err: fmt.Errorf("failed to create request: %w", err)}
 	}
 
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
@@ -100,13 +252,13 @@ func (c *PerplexityClient) CreateCompletion(ctx context.Context, messages []Perp
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, 0, &retryableError{err: fmt.Errorf("failed to send request: %w", err), retryable: true}
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, 0, &retryableError{err: fmt.Errorf("failed to read response body: %w", err), retryable: true}
 	}
 
 	if isDebug {
@@ -115,26 +267,37 @@ func (c *PerplexityClient) CreateCompletion(ctx context.Context, messages []Perp
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		// Try to parse error response
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"))
+
 		var errorResp struct {
 			Error PerplexityError `json:"error"`
 		}
 		if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error.Message != "" {
-			return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, errorResp.Error.Message)
+			return nil, retryAfter, &retryableError{
+				err:        fmt.Errorf("API error (status %d): %s", resp.StatusCode, errorResp.Error.Message),
+				retryAfter: retryAfter,
+				retryable:  retryableStatus(resp.StatusCode),
+				statusCode: resp.StatusCode,
+			}
+		}
+		return nil, retryAfter, &retryableError{
+			err:        fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body)),
+			retryAfter: retryAfter,
+			retryable:  retryableStatus(resp.StatusCode),
+			statusCode: resp.StatusCode,
 		}
-		return nil, fmt.Errorf("unexpected status code: %d, body: %s", resp.StatusCode, string(body))
 	}
 
 	var response PerplexityResponse
 	if err := json.Unmarshal(body, &response); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w", err)
+		return nil, 0, &retryableError{err: fmt.Errorf("failed to parse response: %w", err)}
 	}
 
 	if response.Error != nil {
-		return nil, fmt.Errorf("API error: %s", response.Error.Message)
+		return nil, 0, &retryableError{err: fmt.Errorf("API error: %s", response.Error.Message)}
 	}
 
-	return &response, nil
+	return &response, 0, nil
 }
 
 // GetLastContent extracts the content from the last message in the response
@@ -143,4 +306,13 @@ func (r *PerplexityResponse) GetLastContent() string {
 		return r.Choices[0].Message.Content
 	}
 	return ""
+}
+
+// GetCitations returns the source URLs Perplexity used to ground the response,
+// or an empty slice if the model returned none.
+func (r *PerplexityResponse) GetCitations() []string {
+	if r.Citations == nil {
+		return []string{}
+	}
+	return r.Citations
 }
\ No newline at end of file
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Retry tuning for PerplexityClient.CreateCompletion. Backoff doubles from
+// retryBaseDelay up to retryMaxDelay, with full jitter applied on top.
+const (
+	defaultMaxRetries = 4
+	retryBaseDelay    = 500 * time.Millisecond
+	retryMaxDelay     = 10 * time.Second
+)
+
+// Circuit breaker tuning, keyed by host so a sustained outage against one
+// upstream doesn't also block unrelated hosts.
+const (
+	circuitBreakerFailureThreshold = 5
+	circuitBreakerCooldown         = 30 * time.Second
+)
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// circuitBreaker is a minimal per-host breaker: it opens after consecutive
+// failures and, once the cooldown has elapsed, moves to half-open and lets
+// requests through again, closing on a success and reopening on a failure.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+var circuitBreakers sync.Map // host (string) -> *circuitBreaker
+
+func getCircuitBreaker(host string) *circuitBreaker {
+	v, _ := circuitBreakers.LoadOrStore(host, &circuitBreaker{})
+	return v.(*circuitBreaker)
+}
+
+// allow reports whether a request may proceed, transitioning an open breaker
+// to half-open once the cooldown has elapsed.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != circuitOpen {
+		return true
+	}
+	if time.Since(cb.openedAt) < circuitBreakerCooldown {
+		return false
+	}
+
+	cb.state = circuitHalfOpen
+	return true
+}
+
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures = 0
+	cb.state = circuitClosed
+}
+
+func (cb *circuitBreaker) recordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures++
+	if cb.state == circuitHalfOpen || cb.failures >= circuitBreakerFailureThreshold {
+		cb.state = circuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// retryDelay returns the full-jitter exponential backoff delay for the given
+// retry attempt (0-indexed), honoring an upstream Retry-After header when
+// present.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+
+	backoff := retryBaseDelay * time.Duration(1<<uint(attempt))
+	if backoff > retryMaxDelay {
+		backoff = retryMaxDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// parseRetryAfter parses the Retry-After header, which Perplexity sends as
+// either an integer number of seconds or an HTTP-date.
+func parseRetryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(header); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// emitEMFMetric logs a CloudWatch Embedded Metric Format document so
+// PerplexityRetries/CircuitOpen counts can be graphed and alarmed on without
+// a separate PutMetricData call.
+func emitEMFMetric(name string, value float64) {
+	doc := map[string]interface{}{
+		"_aws": map[string]interface{}{
+			"Timestamp": time.Now().UnixMilli(),
+			"CloudWatchMetrics": []map[string]interface{}{
+				{
+					"Namespace":  "WebResearchTool",
+					"Dimensions": [][]string{{}},
+					"Metrics":    []map[string]string{{"Name": name, "Unit": "Count"}},
+				},
+			},
+		},
+		name: value,
+	}
+
+	if b, err := json.Marshal(doc); err == nil {
+		fmt.Println(string(b))
+	}
+}
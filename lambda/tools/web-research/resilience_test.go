@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter time.Duration
+		wantExact  time.Duration // non-zero when the result must be exact
+		wantMax    time.Duration // upper bound for jittered backoff
+	}{
+		{name: "honors Retry-After over backoff", attempt: 3, retryAfter: 7 * time.Second, wantExact: 7 * time.Second},
+		{name: "first attempt backoff capped by base delay", attempt: 0, wantMax: retryBaseDelay},
+		{name: "backoff caps at retryMaxDelay for large attempts", attempt: 10, wantMax: retryMaxDelay},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			delay := retryDelay(tc.attempt, tc.retryAfter)
+			if tc.wantExact > 0 {
+				assert.Equal(t, tc.wantExact, delay)
+				return
+			}
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, tc.wantMax)
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{name: "empty header", header: "", want: 0},
+		{name: "integer seconds", header: "30", want: 30 * time.Second},
+		{name: "invalid header", header: "not-a-date", want: 0},
+		{name: "past HTTP-date yields zero", header: time.Unix(0, 0).UTC().Format(http.TimeFormat), want: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, parseRetryAfter(tc.header))
+		})
+	}
+}
+
+func TestParseRetryAfterFutureDate(t *testing.T) {
+	future := time.Now().Add(1 * time.Hour)
+	got := parseRetryAfter(future.Format(http.TimeFormat))
+	assert.Greater(t, got, time.Duration(0))
+	assert.LessOrEqual(t, got, 1*time.Hour+time.Second)
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cb := &circuitBreaker{}
+
+	assert.True(t, cb.allow(), "a fresh breaker should allow requests")
+
+	for i := 0; i < circuitBreakerFailureThreshold-1; i++ {
+		cb.recordFailure()
+		assert.True(t, cb.allow(), "breaker should stay closed below the failure threshold")
+	}
+
+	cb.recordFailure()
+	assert.False(t, cb.allow(), "breaker should open once the failure threshold is reached")
+
+	cb.openedAt = time.Now().Add(-circuitBreakerCooldown - time.Second)
+	assert.True(t, cb.allow(), "breaker should allow a probe request once the cooldown elapses")
+	assert.Equal(t, circuitHalfOpen, cb.state)
+
+	cb.recordSuccess()
+	assert.True(t, cb.allow())
+	assert.Equal(t, circuitClosed, cb.state)
+	assert.Equal(t, 0, cb.failures)
+}
+
+func TestCircuitBreakerHalfOpenFailureReopens(t *testing.T) {
+	cb := &circuitBreaker{state: circuitHalfOpen}
+	cb.recordFailure()
+	assert.Equal(t, circuitOpen, cb.state)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// defaultS3OffloadThresholdBytes is the inline payload size above which a
+// result is automatically offloaded to S3 even without an explicit
+// output_mode, as long as RESULT_S3_BUCKET is configured.
+const defaultS3OffloadThresholdBytes = 200 * 1024
+
+// s3ResultPointer is the Content payload returned in place of the inline
+// result when a research result has been offloaded to S3.
+type s3ResultPointer struct {
+	S3URI  string `json:"s3_uri"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// getS3OffloadThreshold returns the inline payload size limit, read from
+// RESULT_S3_THRESHOLD_BYTES and falling back to defaultS3OffloadThresholdBytes.
+func getS3OffloadThreshold() int {
+	raw := os.Getenv("RESULT_S3_THRESHOLD_BYTES")
+	if raw == "" {
+		return defaultS3OffloadThresholdBytes
+	}
+
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Printf("[WARNING] Invalid RESULT_S3_THRESHOLD_BYTES %q, using default %d", raw, defaultS3OffloadThresholdBytes)
+		return defaultS3OffloadThresholdBytes
+	}
+
+	return n
+}
+
+// resolveResultContent decides whether resultJSON should be returned inline
+// or offloaded to S3, per the opt-in RESULT_S3_BUCKET/output_mode rules, and
+// returns the string to place in ToolResponse.Content.
+func resolveResultContent(ctx context.Context, requestID string, outputMode string, resultJSON []byte) (string, error) {
+	bucket := os.Getenv("RESULT_S3_BUCKET")
+	wantsS3 := outputMode == "s3"
+	overThreshold := bucket != "" && len(resultJSON) > getS3OffloadThreshold()
+
+	if !wantsS3 && !overThreshold {
+		return string(resultJSON), nil
+	}
+
+	if bucket == "" {
+		return "", fmt.Errorf("output_mode %q requested but RESULT_S3_BUCKET is not configured", outputMode)
+	}
+
+	if overThreshold && !wantsS3 {
+		log.Printf("[INFO] Result payload (%d bytes) exceeds inline threshold, offloading to S3", len(resultJSON))
+	}
+
+	return offloadResultToS3(ctx, bucket, requestID, resultJSON)
+}
+
+// offloadResultToS3 writes resultJSON to s3://bucket/web-research/<requestID>.json
+// and returns the JSON-encoded pointer payload describing it.
+func offloadResultToS3(ctx context.Context, bucket, requestID string, resultJSON []byte) (string, error) {
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to create S3 client: %w", err)
+	}
+
+	key := fmt.Sprintf("web-research/%s.json", requestID)
+	sum := sha256.Sum256(resultJSON)
+	checksum := hex.EncodeToString(sum[:])
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(resultJSON),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload result to s3://%s/%s: %w", bucket, key, err)
+	}
+
+	pointer := s3ResultPointer{
+		S3URI:  fmt.Sprintf("s3://%s/%s", bucket, key),
+		Size:   len(resultJSON),
+		SHA256: checksum,
+	}
+
+	pointerJSON, err := json.Marshal(pointer)
+	if err != nil {
+		return "", fmt.Errorf("failed to format S3 pointer: %w", err)
+	}
+
+	log.Printf("[INFO] Offloaded result to %s (%d bytes)", pointer.S3URI, pointer.Size)
+	return string(pointerJSON), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveResultContent(t *testing.T) {
+	small := []byte(`{"company":"Apple"}`)
+
+	tests := []struct {
+		name         string
+		outputMode   string
+		bucket       string
+		thresholdEnv string
+		resultJSON   []byte
+		wantInline   bool
+		wantErr      bool
+	}{
+		{
+			name:       "small payload with no output_mode stays inline",
+			outputMode: "",
+			bucket:     "",
+			resultJSON: small,
+			wantInline: true,
+		},
+		{
+			name:       "s3 output_mode without a configured bucket errors",
+			outputMode: "s3",
+			bucket:     "",
+			resultJSON: small,
+			wantErr:    true,
+		},
+		{
+			name:         "payload over threshold without a bucket stays inline",
+			outputMode:   "",
+			bucket:       "",
+			thresholdEnv: "8",
+			resultJSON:   small,
+			wantInline:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("RESULT_S3_BUCKET", tc.bucket)
+			t.Setenv("RESULT_S3_THRESHOLD_BYTES", tc.thresholdEnv)
+
+			content, err := resolveResultContent(context.Background(), "req-id", tc.outputMode, tc.resultJSON)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.wantInline {
+				assert.Equal(t, string(tc.resultJSON), content)
+			}
+		})
+	}
+}
+
+func TestGetS3OffloadThreshold(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want int
+	}{
+		{name: "unset falls back to default", env: "", want: defaultS3OffloadThresholdBytes},
+		{name: "valid override", env: "1024", want: 1024},
+		{name: "invalid override falls back to default", env: "not-a-number", want: defaultS3OffloadThresholdBytes},
+		{name: "non-positive override falls back to default", env: "0", want: defaultS3OffloadThresholdBytes},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("RESULT_S3_THRESHOLD_BYTES", tc.env)
+			assert.Equal(t, tc.want, getS3OffloadThreshold())
+		})
+	}
+}
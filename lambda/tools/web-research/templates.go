@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+//go:embed default_templates.json
+var defaultTemplatesJSON []byte
+
+// defaultTemplateKey is the registry entry used when a topic has no
+// dedicated template.
+const defaultTemplateKey = "_default"
+
+// TopicPromptData is the data made available to topic prompt templates.
+type TopicPromptData struct {
+	Company       string
+	Topic         string
+	RecencyWindow string
+	Locale        string
+}
+
+var (
+	templateRegistry     map[string]*template.Template
+	templateRegistryOnce sync.Once
+	templateRegistryErr  error
+)
+
+// getTemplateRegistry loads the topic-to-prompt template registry once per
+// Lambda execution environment, preferring an operator-supplied override
+// (the "web-research" entry of the consolidated secret, or the JSON blob at
+// PROMPT_TEMPLATES_URI) and falling back to the embedded defaults.
+func getTemplateRegistry(ctx context.Context) (map[string]*template.Template, error) {
+	templateRegistryOnce.Do(func() {
+		raw, err := loadTemplateSource(ctx)
+		if err != nil {
+			log.Printf("[WARNING] Failed to load prompt template overrides, using embedded defaults: %v", err)
+			raw = defaultTemplatesJSON
+		}
+
+		registry, err := parseTemplateRegistry(raw)
+		if err != nil {
+			log.Printf("[WARNING] Failed to parse prompt templates, falling back to embedded defaults: %v", err)
+			registry, err = parseTemplateRegistry(defaultTemplatesJSON)
+			if err != nil {
+				templateRegistryErr = fmt.Errorf("failed to parse embedded default templates: %w", err)
+				return
+			}
+		}
+
+		if _, ok := registry[defaultTemplateKey]; !ok {
+			templateRegistryErr = fmt.Errorf("prompt template registry is missing required %q entry", defaultTemplateKey)
+			return
+		}
+
+		templateRegistry = registry
+	})
+
+	return templateRegistry, templateRegistryErr
+}
+
+// loadTemplateSource resolves the raw JSON template map, preferring
+// PROMPT_TEMPLATES_URI (an s3:// URI) over the consolidated secret's
+// "web-research" entry, and finally the embedded defaults.
+func loadTemplateSource(ctx context.Context) ([]byte, error) {
+	if uri := os.Getenv("PROMPT_TEMPLATES_URI"); uri != "" {
+		log.Printf("[INFO] Loading prompt templates from %s", uri)
+		return fetchTemplatesFromS3(ctx, uri)
+	}
+
+	toolSecrets, err := GetToolSecrets(ctx, "web-research")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load consolidated secrets: %w", err)
+	}
+
+	if blob, ok := toolSecrets["PROMPT_TEMPLATES"]; ok && blob != "" {
+		log.Printf("[INFO] Loading prompt templates from consolidated secret")
+		return []byte(blob), nil
+	}
+
+	return defaultTemplatesJSON, nil
+}
+
+// fetchTemplatesFromS3 downloads the template JSON blob referenced by an
+// s3://bucket/key URI.
+func fetchTemplatesFromS3(ctx context.Context, uri string) ([]byte, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROMPT_TEMPLATES_URI %q: %w", uri, err)
+	}
+	if parsed.Scheme != "s3" {
+		return nil, fmt.Errorf("unsupported PROMPT_TEMPLATES_URI scheme %q, expected s3://", parsed.Scheme)
+	}
+
+	client, err := getS3Client(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create S3 client: %w", err)
+	}
+
+	key := strings.TrimPrefix(parsed.Path, "/")
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: &parsed.Host,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", uri, err)
+	}
+	defer out.Body.Close()
+
+	data, err := io.ReadAll(out.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", uri, err)
+	}
+
+	return data, nil
+}
+
+// parseTemplateRegistry parses a JSON map of topic -> Go text/template
+// source into compiled templates.
+func parseTemplateRegistry(raw []byte) (map[string]*template.Template, error) {
+	var sources map[string]string
+	if err := json.Unmarshal(raw, &sources); err != nil {
+		return nil, fmt.Errorf("invalid template JSON: %w", err)
+	}
+
+	registry := make(map[string]*template.Template, len(sources))
+	for topic, src := range sources {
+		tmpl, err := template.New(topic).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template for topic %q: %w", topic, err)
+		}
+		registry[topic] = tmpl
+	}
+
+	return registry, nil
+}
+
+// renderTopicPrompt renders the prompt for a topic, falling back to the
+// registry's default template for topics without a dedicated entry.
+func renderTopicPrompt(ctx context.Context, data TopicPromptData) (string, error) {
+	registry, err := getTemplateRegistry(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, ok := registry[data.Topic]
+	if !ok {
+		tmpl = registry[defaultTemplateKey]
+	}
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template for topic %q: %w", data.Topic, err)
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTemplateRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+		topics  []string
+	}{
+		{
+			name:   "valid registry",
+			raw:    `{"_default": "Tell me about {{.Company}}", "recent news": "News on {{.Company}}"}`,
+			topics: []string{defaultTemplateKey, "recent news"},
+		},
+		{
+			name:    "invalid JSON",
+			raw:     `not json`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid template syntax",
+			raw:     `{"_default": "{{.Company"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			registry, err := parseTemplateRegistry([]byte(tc.raw))
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			for _, topic := range tc.topics {
+				assert.Contains(t, registry, topic)
+			}
+		})
+	}
+}
+
+// withTemplateRegistry installs registry as the package-level template
+// registry for the duration of the test, bypassing getTemplateRegistry's
+// normal load path (which requires live AWS/S3 access), and afterward
+// restores the prior registry and error and resets the load-once guard.
+func withTemplateRegistry(t *testing.T, registry map[string]*template.Template) {
+	t.Helper()
+	prevRegistry, prevErr := templateRegistry, templateRegistryErr
+
+	templateRegistryOnce = sync.Once{}
+	templateRegistryOnce.Do(func() {
+		templateRegistry = registry
+		templateRegistryErr = nil
+	})
+
+	t.Cleanup(func() {
+		templateRegistry, templateRegistryErr = prevRegistry, prevErr
+		templateRegistryOnce = sync.Once{}
+	})
+}
+
+func TestRenderTopicPromptFallsBackToDefault(t *testing.T) {
+	defaultTmpl := template.Must(template.New(defaultTemplateKey).Parse("default for {{.Topic}}"))
+	newsTmpl := template.Must(template.New("recent news").Parse("news for {{.Company}}"))
+	withTemplateRegistry(t, map[string]*template.Template{
+		defaultTemplateKey: defaultTmpl,
+		"recent news":      newsTmpl,
+	})
+
+	out, err := renderTopicPrompt(context.Background(), TopicPromptData{Company: "Acme", Topic: "recent news"})
+	assert.NoError(t, err)
+	assert.Equal(t, "news for Acme", out)
+
+	out, err = renderTopicPrompt(context.Background(), TopicPromptData{Company: "Acme", Topic: "an unregistered topic"})
+	assert.NoError(t, err)
+	assert.Equal(t, "default for an unregistered topic", out)
+}
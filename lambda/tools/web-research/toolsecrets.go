@@ -6,21 +6,80 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go/aws"
 )
 
+// defaultSecretsCacheTTL is how long the consolidated secrets cache is
+// trusted before GetAllSecrets checks Secrets Manager for a rotation.
+const defaultSecretsCacheTTL = 5 * time.Minute
+
 // Global variables for caching
 var (
-	cachedSecrets map[string]map[string]string
-	cacheMutex    sync.RWMutex
-	cacheOnce     sync.Once
+	cachedSecrets         map[string]map[string]string
+	cachedSecretVersionID string
+	cacheLoadedAt         time.Time
+	cacheLoaded           bool
+	cacheMutex            sync.RWMutex
+
+	cachedAWSConfig awssdk.Config
+	awsConfigOnce   sync.Once
+	awsConfigErr    error
+
+	cachedS3Client *s3.Client
+	s3ClientOnce   sync.Once
 )
 
+// getSecretsCacheTTL returns the TTL after which a cache hit triggers a
+// rotation check, read from SECRETS_CACHE_TTL_SECONDS and falling back to
+// defaultSecretsCacheTTL.
+func getSecretsCacheTTL() time.Duration {
+	raw := os.Getenv("SECRETS_CACHE_TTL_SECONDS")
+	if raw == "" {
+		return defaultSecretsCacheTTL
+	}
+
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		log.Printf("[WARNING] Invalid SECRETS_CACHE_TTL_SECONDS %q, using default %s", raw, defaultSecretsCacheTTL)
+		return defaultSecretsCacheTTL
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// getAWSConfig loads the AWS SDK config once per Lambda execution
+// environment so repeat cold-start-sensitive calls (Secrets Manager, S3)
+// don't each pay the config resolution cost.
+func getAWSConfig(ctx context.Context) (awssdk.Config, error) {
+	awsConfigOnce.Do(func() {
+		cachedAWSConfig, awsConfigErr = config.LoadDefaultConfig(ctx)
+	})
+	return cachedAWSConfig, awsConfigErr
+}
+
+// getS3Client returns the cached S3 client, creating it from the cached AWS
+// config on first use.
+func getS3Client(ctx context.Context) (*s3.Client, error) {
+	cfg, err := getAWSConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s3ClientOnce.Do(func() {
+		cachedS3Client = s3.NewFromConfig(cfg)
+	})
+	return cachedS3Client, nil
+}
+
 // getConsolidatedSecretName returns the consolidated secret name from environment or default
 func getConsolidatedSecretName() string {
 	envName := os.Getenv("ENVIRONMENT")
@@ -36,71 +95,151 @@ func getConsolidatedSecretName() string {
 	return secretName
 }
 
-// GetAllSecrets retrieves all secrets from the consolidated secret
-// Results are cached for the Lambda execution context
+// GetAllSecrets retrieves all secrets from the consolidated secret. Results
+// are cached for the Lambda execution context behind a mutex-guarded
+// cold-start check; once the cache's TTL (getSecretsCacheTTL) has elapsed, a
+// hit instead issues a cheap DescribeSecret and only re-fetches
+// GetSecretValue when Secrets Manager reports a new AWSCURRENT version.
 func GetAllSecrets(ctx context.Context) (map[string]map[string]string, error) {
-	// Return cached value if available
 	cacheMutex.RLock()
-	if cachedSecrets != nil {
+	fresh := cacheLoaded && time.Since(cacheLoadedAt) < getSecretsCacheTTL()
+	cacheMutex.RUnlock()
+	if fresh {
+		cacheMutex.RLock()
 		defer cacheMutex.RUnlock()
 		return cachedSecrets, nil
 	}
-	cacheMutex.RUnlock()
 
-	// Load secrets once
-	var loadErr error
-	cacheOnce.Do(func() {
-		secretName := getConsolidatedSecretName()
-		log.Printf("[INFO] Loading consolidated secrets from: %s", secretName)
-		
-		// Load AWS config
-		cfg, err := config.LoadDefaultConfig(ctx)
-		if err != nil {
-			loadErr = fmt.Errorf("unable to load SDK config: %v", err)
-			log.Printf("[ERROR] Failed to load AWS SDK config: %v", err)
-			return
-		}
-		
-		// Create Secrets Manager client
-		svc := secretsmanager.NewFromConfig(cfg)
-		secret, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-			SecretId: aws.String(secretName),
-		})
-		if err != nil {
-			loadErr = fmt.Errorf("unable to get secret: %v", err)
-			log.Printf("[ERROR] Failed to retrieve secret %s: %v", secretName, err)
-			return
-		}
-		
-		log.Printf("[DEBUG] Secret retrieved, parsing JSON...")
-		
-		// Parse secret JSON
-		var secrets map[string]map[string]string
-		if err := json.Unmarshal([]byte(*secret.SecretString), &secrets); err != nil {
-			loadErr = fmt.Errorf("unable to parse secret: %v", err)
-			log.Printf("[ERROR] Failed to parse secret JSON: %v", err)
-			return
+	// Cold start (or a cache cleared by ClearCache): load the secret. A
+	// concurrent caller racing this one may also see cacheLoaded == false
+	// and issue its own reload; that's a harmless duplicate GetSecretValue
+	// call rather than a correctness problem, and in practice Lambda
+	// serializes invocations within a single execution environment anyway.
+	cacheMutex.RLock()
+	loaded := cacheLoaded
+	cacheMutex.RUnlock()
+	if !loaded {
+		if err := reloadSecrets(ctx); err != nil {
+			return nil, err
 		}
-		
-		log.Printf("[INFO] Successfully loaded secrets for %d tools", len(secrets))
-		for toolName := range secrets {
-			log.Printf("[DEBUG] Tool in secrets: %s", toolName)
+	}
+
+	// The cache may now be populated (by this call, or an earlier one).
+	// If it's stale, double-check against Secrets Manager before serving it.
+	cacheMutex.RLock()
+	stale := time.Since(cacheLoadedAt) >= getSecretsCacheTTL()
+	cacheMutex.RUnlock()
+
+	if stale {
+		if err := refreshIfRotated(ctx); err != nil {
+			log.Printf("[WARNING] Failed to check consolidated secret for rotation, serving cached value: %v", err)
 		}
-		
-		cacheMutex.Lock()
-		cachedSecrets = secrets
-		cacheMutex.Unlock()
-	})
-	
-	if loadErr != nil {
-		return nil, loadErr
 	}
-	
+
 	cacheMutex.RLock()
 	defer cacheMutex.RUnlock()
 	return cachedSecrets, nil
 }
 
+// reloadSecrets unconditionally fetches and parses the consolidated secret,
+// populating the cache under a write lock.
+func reloadSecrets(ctx context.Context) error {
+	secretName := getConsolidatedSecretName()
+	log.Printf("[INFO] Loading consolidated secrets from: %s", secretName)
+
+	cfg, err := getAWSConfig(ctx)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load AWS SDK config: %v", err)
+		return fmt.Errorf("unable to load SDK config: %v", err)
+	}
+
+	svc := secretsmanager.NewFromConfig(cfg)
+	secret, err := svc.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretName),
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to retrieve secret %s: %v", secretName, err)
+		return fmt.Errorf("unable to get secret: %v", err)
+	}
+
+	log.Printf("[DEBUG] Secret retrieved, parsing JSON...")
+
+	var secrets map[string]map[string]string
+	if err := json.Unmarshal([]byte(*secret.SecretString), &secrets); err != nil {
+		log.Printf("[ERROR] Failed to parse secret JSON: %v", err)
+		return fmt.Errorf("unable to parse secret: %v", err)
+	}
+
+	log.Printf("[INFO] Successfully loaded secrets for %d tools", len(secrets))
+	for toolName := range secrets {
+		log.Printf("[DEBUG] Tool in secrets: %s", toolName)
+	}
+
+	cacheMutex.Lock()
+	cachedSecrets = secrets
+	cacheLoadedAt = time.Now()
+	cacheLoaded = true
+	if secret.VersionId != nil {
+		cachedSecretVersionID = *secret.VersionId
+	}
+	cacheMutex.Unlock()
+
+	return nil
+}
+
+// secretVersionRotated reports whether currentVersionID (the version
+// Secrets Manager currently marks AWSCURRENT) differs from knownVersionID
+// (the version the cache last loaded). An empty currentVersionID means
+// DescribeSecret didn't report an AWSCURRENT stage, which is treated as "not
+// rotated" since there's nothing conclusive to reload.
+func secretVersionRotated(currentVersionID, knownVersionID string) bool {
+	return currentVersionID != "" && currentVersionID != knownVersionID
+}
+
+// refreshIfRotated checks whether Secrets Manager has promoted a new
+// AWSCURRENT version since the cache was last loaded, re-fetching the full
+// secret only when it has. This keeps the common case (no rotation) to a
+// cheap DescribeSecret call instead of a full GetSecretValue.
+func refreshIfRotated(ctx context.Context) error {
+	cfg, err := getAWSConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load SDK config: %w", err)
+	}
+
+	svc := secretsmanager.NewFromConfig(cfg)
+	desc, err := svc.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(getConsolidatedSecretName()),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to describe secret: %w", err)
+	}
+
+	var currentVersionID string
+	for versionID, stages := range desc.VersionIdsToStages {
+		for _, stage := range stages {
+			if stage == "AWSCURRENT" {
+				currentVersionID = versionID
+			}
+		}
+	}
+
+	cacheMutex.RLock()
+	knownVersionID := cachedSecretVersionID
+	cacheMutex.RUnlock()
+
+	if !secretVersionRotated(currentVersionID, knownVersionID) {
+		// No rotation: just extend the TTL window.
+		cacheMutex.Lock()
+		cacheLoadedAt = time.Now()
+		cacheMutex.Unlock()
+		log.Printf("[DEBUG] Consolidated secret version unchanged (%s), cache still valid", currentVersionID)
+		return nil
+	}
+
+	log.Printf("[INFO] Consolidated secret version changed (%s -> %s), reloading", knownVersionID, currentVersionID)
+	return reloadSecrets(ctx)
+}
+
 // GetToolSecrets retrieves secrets for a specific tool from the consolidated secret
 func GetToolSecrets(ctx context.Context, toolName string) (map[string]string, error) {
 	allSecrets, err := GetAllSecrets(ctx)
@@ -203,10 +342,13 @@ func LoadSecretsToEnv(ctx context.Context, toolName string) error {
 	return nil
 }
 
-// ClearCache clears the cached secrets (useful for testing)
+// ClearCache clears the cached secrets (useful for testing, and for forcing
+// a reload after an upstream 401/403 suggests the cached key is stale)
 func ClearCache() {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 	cachedSecrets = nil
-	cacheOnce = sync.Once{}
+	cachedSecretVersionID = ""
+	cacheLoadedAt = time.Time{}
+	cacheLoaded = false
 }
\ No newline at end of file
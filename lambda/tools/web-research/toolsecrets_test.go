@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretVersionRotated(t *testing.T) {
+	tests := []struct {
+		name       string
+		current    string
+		known      string
+		wantRotate bool
+	}{
+		{name: "unchanged version is not a rotation", current: "v1", known: "v1", wantRotate: false},
+		{name: "different version is a rotation", current: "v2", known: "v1", wantRotate: true},
+		{name: "no known version yet is a rotation", current: "v1", known: "", wantRotate: true},
+		{name: "no AWSCURRENT stage reported is not treated as a rotation", current: "", known: "v1", wantRotate: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantRotate, secretVersionRotated(tc.current, tc.known))
+		})
+	}
+}